@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultDebounce is used when a Dir doesn't configure debounce_ms
+const defaultDebounce = 300 * time.Millisecond
+
+// debouncer coalesces rapid trigger calls into a single run of fn after a
+// quiet period of d, and guarantees at most one in-flight fn at a time: a
+// trigger that arrives while fn is still running queues a follow-up run
+// instead of starting a second one.
+type debouncer struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	d       time.Duration
+	fn      func()
+	running bool
+	queued  bool
+}
+
+// newDebouncer returns a debouncer that runs fn after d of quiet
+func newDebouncer(d time.Duration, fn func()) *debouncer {
+	return &debouncer{d: d, fn: fn}
+}
+
+// trigger (re)starts the quiet timer, firing fn once it elapses without a
+// further trigger
+func (b *debouncer) trigger() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.timer = time.AfterFunc(b.d, b.fire)
+}
+
+// fire runs fn, or marks a run as queued if fn is already running
+func (b *debouncer) fire() {
+	b.mu.Lock()
+	if b.running {
+		b.queued = true
+		b.mu.Unlock()
+		return
+	}
+	b.running = true
+	b.mu.Unlock()
+
+	b.fn()
+
+	b.mu.Lock()
+	b.running = false
+	requeue := b.queued
+	b.queued = false
+	b.mu.Unlock()
+
+	if requeue {
+		b.fire()
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDebouncerCoalescesRapidTriggers(t *testing.T) {
+	var calls int32
+	b := newDebouncer(20*time.Millisecond, func() {
+		atomic.AddInt32(&calls, 1)
+	})
+
+	for i := 0; i < 5; i++ {
+		b.trigger()
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 call after coalescing, got %d", got)
+	}
+}
+
+func TestDebouncerQueuesTriggerDuringRun(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+
+	b := newDebouncer(10*time.Millisecond, func() {
+		started <- struct{}{}
+		<-unblock
+		atomic.AddInt32(&calls, 1)
+	})
+
+	b.trigger()
+	<-started // first run is now in-flight
+
+	b.trigger() // should be queued, not dropped or run concurrently
+	time.Sleep(20 * time.Millisecond)
+
+	close(unblock)
+	<-started // the queued run starts as soon as the first finishes
+
+	time.Sleep(20 * time.Millisecond)
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 calls (in-flight run + queued follow-up), got %d", got)
+	}
+}
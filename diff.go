@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Tolerance configures how forgiving the pixel diff is for a Dir
+type Tolerance struct {
+	MaxPixelDelta     int     `toml:"max_pixel_delta"`
+	MaxPercentChanged float64 `toml:"max_percent_changed"`
+}
+
+// baselineName turns a screenshot file name into its baseline counterpart by
+// swapping "screenshot" for "baseline" within wdir's configured screenshot
+// suffix only, e.g. suffix ".screenshot.jpeg" turns
+// "profile.screenshot.jpeg" into "profile.baseline.jpeg". This mirrors how
+// render.screenshotName derives the screenshot suffix from the same pattern,
+// so a "screenshot" appearing in a parent directory segment is left alone
+func baselineName(wdir Dir, screenshotName string) string {
+	suffix := strings.TrimPrefix(wdir.ScreenshotFilePattern, "*")
+	if !strings.HasSuffix(screenshotName, suffix) {
+		return screenshotName
+	}
+
+	base := strings.TrimSuffix(screenshotName, suffix)
+	return base + strings.Replace(suffix, "screenshot", "baseline", 1)
+}
+
+// dirAt returns cfg.Dirs[dirIdx], rejecting an out-of-range index instead of
+// letting it panic. dirIdx comes straight from a URL param, so a handler
+// indexing cfg.Dirs with it directly would panic on any out-of-range value.
+func dirAt(cfg Config, dirIdx int) (Dir, error) {
+	if dirIdx < 0 || dirIdx >= len(cfg.Dirs) {
+		return Dir{}, fmt.Errorf("dir index %d out of range", dirIdx)
+	}
+
+	return cfg.Dirs[dirIdx], nil
+}
+
+// safePath joins name onto dir, rejecting any result that escapes dir. name
+// comes straight from a base64-decoded URL param, so without this check a
+// "../../etc/passwd"-shaped value would survive filepath.Join unchanged.
+func safePath(dir, name string) (string, error) {
+	full := filepath.Join(dir, name)
+
+	rel, err := filepath.Rel(dir, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("screenshot name '%s' escapes dir '%s'", name, dir)
+	}
+
+	return full, nil
+}
+
+// loadDirImage decodes a jpeg that lives inside wdir.Path
+func loadDirImage(wdir Dir, name string) (image.Image, error) {
+	path, err := safePath(wdir.Path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode jpeg '%s': %w", name, err)
+	}
+
+	return img, nil
+}
+
+// pixelDelta returns the largest per-channel difference between two pixels
+func pixelDelta(br, bg, bb, ar, ag, ab uint32) int {
+	delta := func(a, b uint32) int {
+		d := int(a>>8) - int(b>>8)
+		if d < 0 {
+			d = -d
+		}
+		return d
+	}
+
+	max := delta(br, ar)
+	if d := delta(bg, ag); d > max {
+		max = d
+	}
+	if d := delta(bb, ab); d > max {
+		max = d
+	}
+
+	return max
+}
+
+// diffImages compares baseline against actual pixel-by-pixel within tol and
+// renders an image that highlights the pixels that exceeded the tolerance in red
+func diffImages(baseline, actual image.Image, tol Tolerance) (out image.Image, percentChanged float64, pass bool) {
+	bounds := baseline.Bounds()
+	if bounds != actual.Bounds() {
+		return image.NewRGBA(bounds), 100, false
+	}
+
+	img := image.NewRGBA(bounds)
+	var changed int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			br, bg, bb, _ := baseline.At(x, y).RGBA()
+			ar, ag, ab, _ := actual.At(x, y).RGBA()
+
+			if pixelDelta(br, bg, bb, ar, ag, ab) > tol.MaxPixelDelta {
+				changed++
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+				continue
+			}
+
+			img.Set(x, y, color.RGBA{R: uint8(ar >> 8), G: uint8(ag >> 8), B: uint8(ab >> 8), A: 255})
+		}
+	}
+
+	total := bounds.Dx() * bounds.Dy()
+	percentChanged = float64(changed) / float64(total) * 100
+
+	return img, percentChanged, percentChanged <= tol.MaxPercentChanged
+}
+
+// compareStatus reports the visual-diff status ("new", "pass" or "fail") of a
+// single screenshot against its stored baseline
+func compareStatus(wdir Dir, screenshotName string) string {
+	baseline, err := loadDirImage(wdir, baselineName(wdir, screenshotName))
+	if err != nil {
+		return "new"
+	}
+
+	actual, err := loadDirImage(wdir, screenshotName)
+	if err != nil {
+		return "new"
+	}
+
+	if _, _, pass := diffImages(baseline, actual, wdir.Tolerance); pass {
+		return "pass"
+	}
+
+	return "fail"
+}
+
+// baselineImage serves the stored baseline for a screenshot, if one exists
+func baselineImage(cfg Config) ErrHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		screenshotNameB64 := chi.URLParam(r, "screenshot")
+		screenshotName, err := base64.URLEncoding.DecodeString(screenshotNameB64)
+		if err != nil {
+			return fmt.Errorf("failed to decode base64 encoded screenshot name: %w", err)
+		}
+
+		dirIdx, err := strconv.Atoi(chi.URLParam(r, "dirIdx"))
+		if err != nil {
+			return fmt.Errorf("failed to decode dir idx: %w", err)
+		}
+
+		wdir, err := dirAt(cfg, dirIdx)
+		if err != nil {
+			return err
+		}
+
+		path, err := safePath(wdir.Path, baselineName(wdir, string(screenshotName)))
+		if err != nil {
+			return err
+		}
+
+		http.ServeFile(w, r, path)
+		return nil
+	}
+}
+
+// actualImage serves the most recently rendered screenshot, the "actual" side of the comparison
+func actualImage(cfg Config) ErrHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		screenshotNameB64 := chi.URLParam(r, "screenshot")
+		screenshotName, err := base64.URLEncoding.DecodeString(screenshotNameB64)
+		if err != nil {
+			return fmt.Errorf("failed to decode base64 encoded screenshot name: %w", err)
+		}
+
+		dirIdx, err := strconv.Atoi(chi.URLParam(r, "dirIdx"))
+		if err != nil {
+			return fmt.Errorf("failed to decode dir idx: %w", err)
+		}
+
+		wdir, err := dirAt(cfg, dirIdx)
+		if err != nil {
+			return err
+		}
+
+		path, err := safePath(wdir.Path, string(screenshotName))
+		if err != nil {
+			return err
+		}
+
+		http.ServeFile(w, r, path)
+		return nil
+	}
+}
+
+// diffImage renders a pixel-diff between the baseline and the actual screenshot on the fly
+func diffImage(cfg Config) ErrHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		screenshotNameB64 := chi.URLParam(r, "screenshot")
+		screenshotName, err := base64.URLEncoding.DecodeString(screenshotNameB64)
+		if err != nil {
+			return fmt.Errorf("failed to decode base64 encoded screenshot name: %w", err)
+		}
+
+		dirIdx, err := strconv.Atoi(chi.URLParam(r, "dirIdx"))
+		if err != nil {
+			return fmt.Errorf("failed to decode dir idx: %w", err)
+		}
+
+		wdir, err := dirAt(cfg, dirIdx)
+		if err != nil {
+			return err
+		}
+
+		baseline, err := loadDirImage(wdir, baselineName(wdir, string(screenshotName)))
+		if err != nil {
+			return fmt.Errorf("failed to load baseline image: %w", err)
+		}
+
+		actual, err := loadDirImage(wdir, string(screenshotName))
+		if err != nil {
+			return fmt.Errorf("failed to load actual image: %w", err)
+		}
+
+		out, _, _ := diffImages(baseline, actual, wdir.Tolerance)
+		w.Header().Set("Content-Type", "image/jpeg")
+		return jpeg.Encode(w, out, &jpeg.Options{Quality: 90})
+	}
+}
+
+// approveScreenshot promotes the actual screenshot to become the new baseline
+func approveScreenshot(cfg Config) ErrHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		screenshotNameB64 := chi.URLParam(r, "screenshot")
+		screenshotName, err := base64.URLEncoding.DecodeString(screenshotNameB64)
+		if err != nil {
+			return fmt.Errorf("failed to decode base64 encoded screenshot name: %w", err)
+		}
+
+		dirIdx, err := strconv.Atoi(chi.URLParam(r, "dirIdx"))
+		if err != nil {
+			return fmt.Errorf("failed to decode dir idx: %w", err)
+		}
+
+		wdir, err := dirAt(cfg, dirIdx)
+		if err != nil {
+			return err
+		}
+
+		actualPath, err := safePath(wdir.Path, string(screenshotName))
+		if err != nil {
+			return err
+		}
+
+		baselinePath, err := safePath(wdir.Path, baselineName(wdir, string(screenshotName)))
+		if err != nil {
+			return err
+		}
+
+		actual, err := os.ReadFile(actualPath)
+		if err != nil {
+			return fmt.Errorf("failed to read actual screenshot: %w", err)
+		}
+
+		if err := os.WriteFile(baselinePath, actual, 0664); err != nil {
+			return fmt.Errorf("failed to write baseline screenshot: %w", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
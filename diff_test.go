@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidImage(w, h int, c color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestPixelDelta(t *testing.T) {
+	cases := []struct {
+		name       string
+		br, bg, bb uint32
+		ar, ag, ab uint32
+		want       int
+	}{
+		{"identical", 0x8080, 0x8080, 0x8080, 0x8080, 0x8080, 0x8080, 0},
+		{"red channel differs most", 0x0000, 0x8080, 0x8080, 0xffff, 0x8080, 0x8080, 255},
+		{"green channel differs most", 0x8080, 0x0000, 0x8080, 0x8080, 0x4040, 0x8080, 64},
+		{"blue channel differs most", 0xffff, 0xffff, 0x0000, 0xffff, 0xffff, 0x1010, 16},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := pixelDelta(tc.br, tc.bg, tc.bb, tc.ar, tc.ag, tc.ab)
+			if got != tc.want {
+				t.Errorf("pixelDelta() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiffImages(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black := color.RGBA{R: 0, G: 0, B: 0, A: 255}
+
+	cases := []struct {
+		name     string
+		baseline image.Image
+		actual   image.Image
+		tol      Tolerance
+		wantPass bool
+	}{
+		{
+			name:     "identical images pass",
+			baseline: solidImage(4, 4, white),
+			actual:   solidImage(4, 4, white),
+			tol:      Tolerance{MaxPixelDelta: 0, MaxPercentChanged: 0},
+			wantPass: true,
+		},
+		{
+			name:     "fully changed image fails",
+			baseline: solidImage(4, 4, white),
+			actual:   solidImage(4, 4, black),
+			tol:      Tolerance{MaxPixelDelta: 10, MaxPercentChanged: 50},
+			wantPass: false,
+		},
+		{
+			name:     "mismatched bounds always fails",
+			baseline: solidImage(4, 4, white),
+			actual:   solidImage(2, 2, white),
+			tol:      Tolerance{MaxPixelDelta: 255, MaxPercentChanged: 100},
+			wantPass: false,
+		},
+		{
+			name:     "change within percent tolerance passes",
+			baseline: solidImage(4, 4, white),
+			actual:   solidImage(4, 4, black),
+			tol:      Tolerance{MaxPixelDelta: 10, MaxPercentChanged: 100},
+			wantPass: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, pass := diffImages(tc.baseline, tc.actual, tc.tol)
+			if pass != tc.wantPass {
+				t.Errorf("diffImages() pass = %v, want %v", pass, tc.wantPass)
+			}
+		})
+	}
+}
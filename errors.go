@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// dirError describes the most recent retest failure for a Dir, surfaced to
+// the browser as an overlay so a stale screenshot doesn't look like a pass
+type dirError struct {
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+// errorStore holds the latest dirError per Dir index
+type errorStore struct {
+	mu     sync.Mutex
+	errors map[int]*dirError
+}
+
+// newErrorStore inits an empty errorStore
+func newErrorStore() *errorStore {
+	return &errorStore{errors: map[int]*dirError{}}
+}
+
+// set stores de as the current error for dirIdx
+func (s *errorStore) set(dirIdx int, de *dirError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[dirIdx] = de
+}
+
+// clear removes any stored error for dirIdx, e.g. after a retest succeeds
+func (s *errorStore) clear(dirIdx int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.errors, dirIdx)
+}
+
+// get returns the current error for dirIdx, or nil if there isn't one
+func (s *errorStore) get(dirIdx int) *dirError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errors[dirIdx]
+}
+
+// templateErrPattern matches the "template: name:line: message" shape
+// html/template uses for parse errors, and the "template: name:line:col: message"
+// shape it uses for execution errors. The name it captures is only the
+// template's base file name, so it's not used as a path.
+var templateErrPattern = regexp.MustCompile(`template: [^:]+:(\d+)(?::\d+)?: (.*)`)
+
+// templatePathPattern captures the full, glob-matched template path from the
+// "failed to render '<path>' at viewport" wrap render.Dir adds around it
+var templatePathPattern = regexp.MustCompile(`failed to render '([^']+)' at viewport`)
+
+// parseTemplateError extracts the failing file and line from a html/template
+// error wrapped by render.Dir, falling back to the bare error message when it
+// doesn't match
+func parseTemplateError(err error) (file string, line int, message string) {
+	msg := err.Error()
+
+	m := templateErrPattern.FindStringSubmatch(msg)
+	if m == nil {
+		return "", 0, msg
+	}
+
+	line, _ = strconv.Atoi(m[1])
+	message = m[2]
+
+	if p := templatePathPattern.FindStringSubmatch(msg); p != nil {
+		file = p[1]
+	}
+
+	return file, line, message
+}
+
+// goTestErrPattern matches the "file.go:line:" prefix go test emits for a
+// failed t.Error/t.Fatal call (e.g. "    main_test.go:42: some message") or a
+// compile error (e.g. "./main_test.go:10:2: undefined: foo")
+var goTestErrPattern = regexp.MustCompile(`([^\s:]+\.go):(\d+)(?::\d+)?:\s*(.*)`)
+
+// parseTestOutput extracts the failing file and line from go test output,
+// falling back to the bare output when it doesn't match
+func parseTestOutput(output string) (file string, line int, message string) {
+	m := goTestErrPattern.FindStringSubmatch(output)
+	if m == nil {
+		return "", 0, output
+	}
+
+	line, _ = strconv.Atoi(m[2])
+	return m[1], line, m[3]
+}
+
+// snippet reads a few lines of context around line from path, marking the
+// failing line, for display in the browser overlay
+func snippet(path string, line int) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.Split(string(data), "\n")
+	start := line - 3
+	if start < 0 {
+		start = 0
+	}
+	end := line + 2
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	var b strings.Builder
+	for i := start; i < end; i++ {
+		marker := "  "
+		if i+1 == line {
+			marker = "> "
+		}
+		b.WriteString(marker + strconv.Itoa(i+1) + "| " + lines[i] + "\n")
+	}
+
+	return b.String()
+}
+
+// errorsEndpoint serves the current dirError for a Dir as JSON, or null when
+// its last retest succeeded
+func errorsEndpoint(errs *errorStore) ErrHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		dirIdx, err := strconv.Atoi(chi.URLParam(r, "dirIdx"))
+		if err != nil {
+			return fmt.Errorf("failed to decode dir idx: %w", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(errs.get(dirIdx))
+	}
+}
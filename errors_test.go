@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTemplateError(t *testing.T) {
+	cases := []struct {
+		name        string
+		err         error
+		wantFile    string
+		wantLine    int
+		wantMessage string
+	}{
+		{
+			name:        "parse error with template path wrap",
+			err:         errors.New("failed to render 'templates/profile.gotmpl' at viewport 'mobile': failed to parse template: template: profile.gotmpl:12: unexpected EOF"),
+			wantFile:    "templates/profile.gotmpl",
+			wantLine:    12,
+			wantMessage: "unexpected EOF",
+		},
+		{
+			name:        "no template path wrap still extracts line and message",
+			err:         errors.New("template: profile.gotmpl:3: function \"foo\" not defined"),
+			wantFile:    "",
+			wantLine:    3,
+			wantMessage: `function "foo" not defined`,
+		},
+		{
+			name:        "no match falls back to the bare message",
+			err:         errors.New("some unrelated error"),
+			wantFile:    "",
+			wantLine:    0,
+			wantMessage: "some unrelated error",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, line, message := parseTemplateError(tc.err)
+			if file != tc.wantFile || line != tc.wantLine || message != tc.wantMessage {
+				t.Errorf("parseTemplateError() = (%q, %d, %q), want (%q, %d, %q)",
+					file, line, message, tc.wantFile, tc.wantLine, tc.wantMessage)
+			}
+		})
+	}
+}
+
+func TestParseTestOutput(t *testing.T) {
+	cases := []struct {
+		name        string
+		output      string
+		wantFile    string
+		wantLine    int
+		wantMessage string
+	}{
+		{
+			name:        "failed assertion",
+			output:      "--- FAIL: TestFoo (0.00s)\n    main_test.go:42: unexpected value\nFAIL",
+			wantFile:    "main_test.go",
+			wantLine:    42,
+			wantMessage: "unexpected value",
+		},
+		{
+			name:        "compile error with column",
+			output:      "./main_test.go:10:2: undefined: foo",
+			wantFile:    "./main_test.go",
+			wantLine:    10,
+			wantMessage: "undefined: foo",
+		},
+		{
+			name:        "no match falls back to the bare output",
+			output:      "panic: something went wrong",
+			wantFile:    "",
+			wantLine:    0,
+			wantMessage: "panic: something went wrong",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, line, message := parseTestOutput(tc.output)
+			if file != tc.wantFile || line != tc.wantLine || message != tc.wantMessage {
+				t.Errorf("parseTestOutput() = (%q, %d, %q), want (%q, %d, %q)",
+					file, line, message, tc.wantFile, tc.wantLine, tc.wantMessage)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profile.gotmpl")
+	content := "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"
+	if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("marks the failing line", func(t *testing.T) {
+		got := snippet(path, 4)
+		want := "  2| two\n  3| three\n> 4| four\n  5| five\n  6| six\n"
+		if got != want {
+			t.Errorf("snippet() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("clamps the window at the start of the file", func(t *testing.T) {
+		got := snippet(path, 1)
+		want := "> 1| one\n  2| two\n  3| three\n"
+		if got != want {
+			t.Errorf("snippet() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("missing file returns empty string", func(t *testing.T) {
+		if got := snippet(filepath.Join(dir, "missing.gotmpl"), 1); got != "" {
+			t.Errorf("snippet() = %q, want empty string", got)
+		}
+	})
+}
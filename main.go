@@ -1,19 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"embed"
 	"encoding/base64"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/crewlinker/rir/render"
 	"github.com/fsnotify/fsnotify"
 	"github.com/go-chi/chi/v5"
 	"github.com/gohugoio/hugo/livereload"
@@ -25,11 +30,36 @@ type ErrHandlerFunc = func(w http.ResponseWriter, r *http.Request) error
 
 // Dir configures a single watched directory
 type Dir struct {
-	Path                  string   `toml:"path"`
-	TemplateFilePattern   string   `toml:"template_file_pattern"`
-	TestFilePattern       string   `toml:"test_file_pattern"`
-	ScreenshotFilePattern string   `toml:"screenshot_file_pattern"`
-	TestCommand           []string `toml:"test_command"`
+	Path                  string           `toml:"path"`
+	TemplateFilePattern   string           `toml:"template_file_pattern"`
+	DataFilePattern       string           `toml:"data_file_pattern"`
+	TestFilePattern       string           `toml:"test_file_pattern"`
+	ScreenshotFilePattern string           `toml:"screenshot_file_pattern"`
+	TestCommand           []string         `toml:"test_command"`
+	Tolerance             Tolerance        `toml:"tolerance"`
+	Viewports             []render.Options `toml:"viewports"`
+	DebounceMS            int              `toml:"debounce_ms"`
+	Captures              []render.Capture `toml:"capture"`
+}
+
+// debounceDuration returns the Dir's configured debounce window, falling
+// back to defaultDebounce when unset
+func debounceDuration(wdir Dir) time.Duration {
+	if wdir.DebounceMS == 0 {
+		return defaultDebounce
+	}
+
+	return time.Duration(wdir.DebounceMS) * time.Millisecond
+}
+
+// viewports returns the Dir's configured viewports, falling back to a single
+// default viewport when none are configured
+func viewports(wdir Dir) []render.Options {
+	if len(wdir.Viewports) == 0 {
+		return []render.Options{render.DefaultOptions}
+	}
+
+	return wdir.Viewports
 }
 
 // Config configures rir
@@ -38,17 +68,59 @@ type Config struct {
 	Dirs       []Dir  `toml:"dir"`
 }
 
-// retest will run tests and visual diffing
-func retest(logs *zap.Logger, wdir Dir) error {
+// retest renders the Dir's screenshots, or runs its test command when one is
+// configured, stashing any failure in errs so the browser can show an overlay
+// instead of a stale screenshot
+func retest(logs *zap.Logger, rend *render.Renderer, errs *errorStore, dirIdx int, wdir Dir) error {
 	logs.Info("retesting directory", zap.String("dir", wdir.Path))
 
+	if len(wdir.TestCommand) == 0 {
+		if err := rend.Dir(wdir.Path, wdir.TemplateFilePattern, wdir.DataFilePattern,
+			wdir.ScreenshotFilePattern, viewports(wdir)); err != nil {
+			file, line, msg := parseTemplateError(err)
+			de := &dirError{Message: msg}
+			if file != "" {
+				de.File = file
+				de.Line = line
+				de.Snippet = snippet(file, line)
+			}
+
+			errs.set(dirIdx, de)
+			livereload.ForceRefresh()
+			return fmt.Errorf("failed to render dir: %w", err)
+		}
+
+		if err := rend.Captures(wdir.Path, wdir.Captures, wdir.ScreenshotFilePattern, viewports(wdir)); err != nil {
+			errs.set(dirIdx, &dirError{Message: err.Error()})
+			livereload.ForceRefresh()
+			return fmt.Errorf("failed to capture dir: %w", err)
+		}
+
+		errs.clear(dirIdx)
+		livereload.ForceRefresh()
+		return nil
+	}
+
+	var output bytes.Buffer
 	cmd := exec.Command(wdir.TestCommand[0], wdir.TestCommand[1:]...)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	cmd.Stdout = io.MultiWriter(os.Stdout, &output)
 	if err := cmd.Run(); err != nil {
+		de := &dirError{Message: err.Error(), Output: output.String()}
+		if file, line, msg := parseTestOutput(output.String()); file != "" {
+			de.Message = msg
+			de.File = file
+			de.Line = line
+			de.Snippet = snippet(file, line)
+		}
+
+		errs.set(dirIdx, de)
+		livereload.ForceRefresh()
 		return fmt.Errorf("failed to run test command: %w", err)
 	}
 
+	errs.clear(dirIdx)
+	livereload.ForceRefresh()
 	return nil
 }
 
@@ -73,8 +145,24 @@ func init() {
 	livereload.Initialize()
 }
 
+// newDebouncers builds one debouncer per Dir, each coalescing retests onto
+// at most one in-flight run
+func newDebouncers(logs *zap.Logger, rend *render.Renderer, errs *errorStore, cfg Config) []*debouncer {
+	debs := make([]*debouncer, len(cfg.Dirs))
+	for i, wdir := range cfg.Dirs {
+		i, wdir := i, wdir
+		debs[i] = newDebouncer(debounceDuration(wdir), func() {
+			if err := retest(logs, rend, errs, i, wdir); err != nil {
+				logs.Error("failed to test", zap.Error(err))
+			}
+		})
+	}
+
+	return debs
+}
+
 // watch handles filesystem notifacations
-func watch(logs *zap.Logger, cfg Config, w *fsnotify.Watcher) {
+func watch(logs *zap.Logger, cfg Config, debs []*debouncer, w *fsnotify.Watcher) {
 	for {
 		select {
 		case ev, ok := <-w.Events:
@@ -88,11 +176,11 @@ func watch(logs *zap.Logger, cfg Config, w *fsnotify.Watcher) {
 			}
 
 			// concurrently handle dir refreshes
-			for _, wdir := range cfg.Dirs {
+			for i, wdir := range cfg.Dirs {
 				if m, _ := filepath.Match(filepath.Join(wdir.Path, wdir.TestFilePattern), ev.Name); m {
-					go do(logs, "failed to test", func() error { return retest(logs, wdir) })
+					debs[i].trigger()
 				} else if m, _ := filepath.Match(filepath.Join(wdir.Path, wdir.TemplateFilePattern), ev.Name); m {
-					go do(logs, "failed to test", func() error { return retest(logs, wdir) })
+					debs[i].trigger()
 				} else if m, _ := filepath.Match(filepath.Join(wdir.Path, wdir.ScreenshotFilePattern), ev.Name); m {
 					go do(logs, "failed to reload", func() error { return reload(logs, wdir) })
 				}
@@ -118,21 +206,80 @@ func errh(h ErrHandlerFunc) http.HandlerFunc {
 	}
 }
 
-// index shows all screenshots as configured per dir
-func index(cfg Config, v *template.Template) ErrHandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		type screeninfo struct {
-			B64  string
-			Name string
+// screenshotParts splits a screenshot's relative path into the template and
+// viewport name it was rendered from, so the index page can group the grid
+// by template x viewport. A screenshot with no matching viewport name is
+// treated as belonging to a single, unnamed viewport. base is derived from
+// screenshotPattern the same structured way baselineName derives it, rather
+// than assuming the literal substring "screenshot".
+func screenshotParts(rel, screenshotPattern string, configured []render.Options) (tmpl, viewport string) {
+	suffix := strings.TrimPrefix(screenshotPattern, "*")
+	base := strings.TrimSuffix(rel, suffix)
+
+	for _, vp := range configured {
+		if vp.Name == "" {
+			continue
+		}
+		if strings.HasSuffix(base, "."+vp.Name) {
+			return strings.TrimSuffix(base, "."+vp.Name), vp.Name
 		}
+	}
+
+	return base, ""
+}
+
+// screeninfo describes a single screenshot shown on the index page
+type screeninfo struct {
+	B64      string
+	Name     string
+	Status   string
+	Template string
+	Viewport string
+}
+
+// templateRow groups one template's screenshots across viewports into a
+// single index page row, so authors can eyeball responsive breakpoints
+// side by side
+type templateRow struct {
+	Template string
+	Shots    []screeninfo
+}
+
+// groupByTemplate groups shots into rows by Template, preserving the order
+// each template first appears in
+func groupByTemplate(shots []screeninfo) []templateRow {
+	var rows []templateRow
+	idx := map[string]int{}
+	for _, s := range shots {
+		i, ok := idx[s.Template]
+		if !ok {
+			i = len(rows)
+			idx[s.Template] = i
+			rows = append(rows, templateRow{Template: s.Template})
+		}
+		rows[i].Shots = append(rows[i].Shots, s)
+	}
+
+	return rows
+}
+
+// index shows all screenshots as configured per dir, grouped by template x viewport
+func index(cfg Config, v *template.Template, errs *errorStore) ErrHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		var data struct {
 			Config      Config
-			Screenshots map[int][]screeninfo
+			Screenshots map[int][]templateRow
+			Errors      map[int]*dirError
 		}
 
 		data.Config = cfg
-		data.Screenshots = map[int][]screeninfo{}
+		data.Screenshots = map[int][]templateRow{}
+		data.Errors = map[int]*dirError{}
 		for i, wdir := range cfg.Dirs {
+			if de := errs.get(i); de != nil {
+				data.Errors[i] = de
+			}
+
 			matches, err := filepath.Glob(filepath.Join(wdir.Path, wdir.ScreenshotFilePattern))
 			if err != nil {
 				return fmt.Errorf("failed to glob Screenshots: %w", err)
@@ -142,13 +289,20 @@ func index(cfg Config, v *template.Template) ErrHandlerFunc {
 				continue
 			}
 
+			var shots []screeninfo
 			for _, match := range matches {
 				rel, _ := filepath.Rel(wdir.Path, match)
-				data.Screenshots[i] = append(data.Screenshots[i], screeninfo{
-					B64:  base64.URLEncoding.EncodeToString([]byte(rel)),
-					Name: rel,
+				tmpl, vp := screenshotParts(rel, wdir.ScreenshotFilePattern, wdir.Viewports)
+				shots = append(shots, screeninfo{
+					B64:      base64.URLEncoding.EncodeToString([]byte(rel)),
+					Name:     rel,
+					Status:   compareStatus(wdir, rel),
+					Template: tmpl,
+					Viewport: vp,
 				})
 			}
+
+			data.Screenshots[i] = groupByTemplate(shots)
 		}
 
 		return v.ExecuteTemplate(w, "index.gotmpl", data)
@@ -156,7 +310,7 @@ func index(cfg Config, v *template.Template) ErrHandlerFunc {
 }
 
 // screenshot renders the screenshot view
-func view(cfg Config, v *template.Template) ErrHandlerFunc {
+func view(cfg Config, v *template.Template, errs *errorStore) ErrHandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		dirIdx := chi.URLParam(r, "dirIdx")
 		screenshotNameB64 := chi.URLParam(r, "screenshot")
@@ -165,11 +319,17 @@ func view(cfg Config, v *template.Template) ErrHandlerFunc {
 			return fmt.Errorf("failed to de decode base64 encoded screenshot name: %w", err)
 		}
 
+		var de *dirError
+		if i, err := strconv.Atoi(dirIdx); err == nil {
+			de = errs.get(i)
+		}
+
 		return v.ExecuteTemplate(w, "screenshot.gotmpl", struct {
 			Name    string
 			B64Name string
 			DirIdx  string
-		}{string(screenshotName), screenshotNameB64, dirIdx})
+			Error   *dirError
+		}{string(screenshotName), screenshotNameB64, dirIdx, de})
 	}
 }
 
@@ -187,7 +347,17 @@ func screenshot(cfg Config, v *template.Template) ErrHandlerFunc {
 			return fmt.Errorf("failed to decode dir idx: %w", err)
 		}
 
-		http.ServeFile(w, r, filepath.Join(cfg.Dirs[dirIdx].Path, string(screenshotName)))
+		wdir, err := dirAt(cfg, dirIdx)
+		if err != nil {
+			return err
+		}
+
+		path, err := safePath(wdir.Path, string(screenshotName))
+		if err != nil {
+			return err
+		}
+
+		http.ServeFile(w, r, path)
 		return nil
 	}
 }
@@ -212,14 +382,35 @@ func run(ctx context.Context, logs *zap.Logger) error {
 		return fmt.Errorf("failed to parse templates: %w", err)
 	}
 
+	// start the shared headless chrome instance used to render Dirs without a test_command
+	rend, err := render.New(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start renderer: %w", err)
+	}
+	defer rend.Close()
+
+	// holds the most recent retest failure per Dir, for the browser overlay
+	errs := newErrorStore()
+
 	// serve web interface
 	r := chi.NewRouter()
-	r.Method("GET", "/", errh(index(cfg, v)))
-	r.Method("GET", "/view/{dirIdx}/{screenshot}", errh(view(cfg, v)))
+	r.Method("GET", "/", errh(index(cfg, v, errs)))
+	r.Method("GET", "/view/{dirIdx}/{screenshot}", errh(view(cfg, v, errs)))
 	r.Method("GET", "/screenshot/{dirIdx}/{screenshot}", errh(screenshot(cfg, v)))
+	r.Method("GET", "/baseline/{dirIdx}/{screenshot}", errh(baselineImage(cfg)))
+	r.Method("GET", "/actual/{dirIdx}/{screenshot}", errh(actualImage(cfg)))
+	r.Method("GET", "/diff/{dirIdx}/{screenshot}", errh(diffImage(cfg)))
+	r.Method("POST", "/approve/{dirIdx}/{screenshot}", errh(approveScreenshot(cfg)))
+	r.Method("GET", "/errors/{dirIdx}", errh(errorsEndpoint(errs)))
 	r.Mount("/livereload", http.HandlerFunc(livereload.Handler))
 	r.Mount("/livereload.js", http.HandlerFunc(livereload.ServeJS))
-	go http.ListenAndServe(cfg.ListenAddr, r)
+
+	srv := &http.Server{Addr: cfg.ListenAddr, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logs.Error("server failed", zap.Error(err))
+		}
+	}()
 
 	// setup watcher
 	w, err := fsnotify.NewWatcher()
@@ -229,7 +420,8 @@ func run(ctx context.Context, logs *zap.Logger) error {
 	defer w.Close()
 
 	// add watches
-	go watch(logs, cfg, w)
+	debs := newDebouncers(logs, rend, errs, cfg)
+	go watch(logs, cfg, debs, w)
 	for _, wdir := range cfg.Dirs {
 		if err := w.Add(wdir.Path); err != nil {
 			return fmt.Errorf("failed to add watch for dir '%s' %w", wdir.Path, err)
@@ -240,11 +432,17 @@ func run(ctx context.Context, logs *zap.Logger) error {
 
 	// block until done
 	logs.Info("running, Ctrl+c to exit", zap.String("listen_addr", cfg.ListenAddr))
-	select {
-	case <-ctx.Done():
-		logs.Info("shutting down")
-		return nil
+	<-ctx.Done()
+	logs.Info("shutting down")
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
 	}
+
+	return nil
 }
 
 // main entrypoint
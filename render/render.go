@@ -0,0 +1,294 @@
+// Package render renders html/template files to screenshot jpegs using a
+// single, persistent chromedp browser instance that is reused across renders.
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// Options configures how a single template is rendered to an image. Name
+// distinguishes the viewport in output file names when a Dir renders a
+// template at more than one.
+type Options struct {
+	Name              string  `toml:"name"`
+	Width             int64   `toml:"width"`
+	Height            int64   `toml:"height"`
+	DeviceScaleFactor float64 `toml:"device_scale_factor"`
+	JPEGQuality       int     `toml:"jpeg_quality"`
+}
+
+// DefaultOptions are used for any field left unconfigured
+var DefaultOptions = Options{Width: 1280, Height: 800, DeviceScaleFactor: 1, JPEGQuality: 90}
+
+// withDefaults fills any zero-valued field of o with the matching DefaultOptions field
+func withDefaults(o Options) Options {
+	if o.Width == 0 {
+		o.Width = DefaultOptions.Width
+	}
+	if o.Height == 0 {
+		o.Height = DefaultOptions.Height
+	}
+	if o.DeviceScaleFactor == 0 {
+		o.DeviceScaleFactor = DefaultOptions.DeviceScaleFactor
+	}
+	if o.JPEGQuality == 0 {
+		o.JPEGQuality = DefaultOptions.JPEGQuality
+	}
+
+	return o
+}
+
+// Capture configures a single page to screenshot by navigating chromedp
+// straight to a running server, rather than rendering a html/template's
+// inlined output. This lets a Dir capture real, possibly authenticated pages.
+type Capture struct {
+	Name    string            `toml:"name"`
+	URL     string            `toml:"url"`
+	Headers map[string]string `toml:"headers"`
+	Cookies []Cookie          `toml:"cookies"`
+}
+
+// Cookie is set on the page before a Capture's URL is navigated to
+type Cookie struct {
+	Name  string `toml:"name"`
+	Value string `toml:"value"`
+}
+
+// Renderer renders html/template files to screenshot jpegs. It keeps a single
+// headless chrome instance running so individual renders only pay the cost of
+// opening a new tab, not starting a browser.
+type Renderer struct {
+	browserCtx context.Context
+	cancel     context.CancelFunc
+}
+
+// New starts the headless chrome instance that backs all renders until Close is called
+func New(ctx context.Context) (*Renderer, error) {
+	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, chromedp.DefaultExecAllocatorOptions[:]...)
+
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(browserCtx); err != nil {
+		browserCancel()
+		allocCancel()
+		return nil, fmt.Errorf("failed to start headless chrome: %w", err)
+	}
+
+	return &Renderer{
+		browserCtx: browserCtx,
+		cancel: func() {
+			browserCancel()
+			allocCancel()
+		},
+	}, nil
+}
+
+// Close shuts down the underlying chrome instance
+func (r *Renderer) Close() {
+	r.cancel()
+}
+
+// Dir renders every template matching templatePattern inside dir to a
+// screenshot file shaped by screenshotPattern, once per viewport, optionally
+// feeding each template fixture data found via dataPattern
+func (r *Renderer) Dir(dir, templatePattern, dataPattern, screenshotPattern string, viewports []Options) error {
+	if templatePattern == "" {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, templatePattern))
+	if err != nil {
+		return fmt.Errorf("failed to glob templates: %w", err)
+	}
+
+	for _, tmplPath := range matches {
+		for _, opts := range viewports {
+			if err := r.renderOne(tmplPath, dataPattern, screenshotPattern, opts); err != nil {
+				return fmt.Errorf("failed to render '%s' at viewport '%s': %w", tmplPath, opts.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// renderOne parses, executes and screenshots a single template file
+func (r *Renderer) renderOne(tmplPath, dataPattern, screenshotPattern string, opts Options) error {
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	data, err := loadFixture(tmplPath, dataPattern)
+	if err != nil {
+		return fmt.Errorf("failed to load fixture data: %w", err)
+	}
+
+	var html bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&html, filepath.Base(tmplPath), data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	buf, err := r.screenshot(html.String(), withDefaults(opts))
+	if err != nil {
+		return fmt.Errorf("failed to screenshot rendered html: %w", err)
+	}
+
+	out := screenshotName(tmplPath, screenshotPattern, opts.Name)
+	if err := os.WriteFile(out, buf, 0664); err != nil {
+		return fmt.Errorf("failed to write screenshot: %w", err)
+	}
+
+	return nil
+}
+
+// Captures screenshots every configured Capture, once per viewport, by
+// navigating chromedp to its URL with its headers and cookies applied
+func (r *Renderer) Captures(dir string, captures []Capture, screenshotPattern string, viewports []Options) error {
+	for _, capture := range captures {
+		for _, opts := range viewports {
+			if err := r.captureOne(dir, capture, screenshotPattern, opts); err != nil {
+				return fmt.Errorf("failed to capture '%s' at viewport '%s': %w", capture.Name, opts.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// captureOne navigates to a single Capture's URL and writes its screenshot
+func (r *Renderer) captureOne(dir string, capture Capture, screenshotPattern string, opts Options) error {
+	buf, err := r.navigate(capture, withDefaults(opts))
+	if err != nil {
+		return fmt.Errorf("failed to screenshot captured page: %w", err)
+	}
+
+	out := screenshotName(filepath.Join(dir, capture.Name), screenshotPattern, opts.Name)
+	if err := os.WriteFile(out, buf, 0664); err != nil {
+		return fmt.Errorf("failed to write screenshot: %w", err)
+	}
+
+	return nil
+}
+
+// navigate opens a fresh tab on the shared browser, applies capture's headers and
+// cookies, navigates to capture.URL and returns a full-page jpeg screenshot
+func (r *Renderer) navigate(capture Capture, opts Options) ([]byte, error) {
+	ctx, cancel := chromedp.NewContext(r.browserCtx)
+	defer cancel()
+
+	actions := []chromedp.Action{
+		chromedp.EmulateViewport(opts.Width, opts.Height, chromedp.EmulateScale(opts.DeviceScaleFactor)),
+		network.Enable(),
+	}
+
+	if len(capture.Headers) > 0 {
+		headers := make(network.Headers, len(capture.Headers))
+		for k, v := range capture.Headers {
+			headers[k] = v
+		}
+		actions = append(actions, network.SetExtraHTTPHeaders(headers))
+	}
+
+	for _, c := range capture.Cookies {
+		c := c
+		actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+			return network.SetCookie(c.Name, c.Value).WithURL(capture.URL).Do(ctx)
+		}))
+	}
+
+	var buf []byte
+	actions = append(actions, chromedp.Navigate(capture.URL), chromedp.FullScreenshot(&buf, opts.JPEGQuality))
+
+	if err := chromedp.Run(ctx, actions...); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// screenshot opens a fresh tab on the shared browser, loads html as the
+// document content and returns a full-page jpeg screenshot
+func (r *Renderer) screenshot(html string, opts Options) ([]byte, error) {
+	ctx, cancel := chromedp.NewContext(r.browserCtx)
+	defer cancel()
+
+	var buf []byte
+	err := chromedp.Run(ctx,
+		chromedp.EmulateViewport(opts.Width, opts.Height, chromedp.EmulateScale(opts.DeviceScaleFactor)),
+		chromedp.Navigate("about:blank"),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			ft, err := page.GetFrameTree().Do(ctx)
+			if err != nil {
+				return err
+			}
+			return page.SetDocumentContent(ft.Frame.ID, html).Do(ctx)
+		}),
+		chromedp.FullScreenshot(&buf, opts.JPEGQuality),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// loadFixture looks for the fixture file belonging to a template (same base
+// name, dataPattern's extension) and decodes it as TOML or JSON. It returns
+// an empty struct when no dataPattern or no matching file is configured.
+func loadFixture(tmplPath, dataPattern string) (any, error) {
+	if dataPattern == "" {
+		return struct{}{}, nil
+	}
+
+	ext := filepath.Ext(dataPattern)
+	base := strings.TrimSuffix(filepath.Base(tmplPath), filepath.Ext(tmplPath))
+	candidate := filepath.Join(filepath.Dir(tmplPath), base+ext)
+
+	f, err := os.Open(candidate)
+	if os.IsNotExist(err) {
+		return struct{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data any
+	if ext == ".json" {
+		if err := json.NewDecoder(f).Decode(&data); err != nil {
+			return nil, fmt.Errorf("failed to decode json fixture '%s': %w", candidate, err)
+		}
+		return data, nil
+	}
+
+	if _, err := toml.NewDecoder(f).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode toml fixture '%s': %w", candidate, err)
+	}
+
+	return data, nil
+}
+
+// screenshotName derives a template's output screenshot path by swapping its
+// extension for screenshotPattern's suffix, e.g. "profile.gotmpl" with
+// screenshotPattern "*.screenshot.jpeg" becomes "profile.screenshot.jpeg". When
+// viewportName is set it's inserted before the suffix, e.g. "profile.mobile.screenshot.jpeg"
+func screenshotName(tmplPath, screenshotPattern, viewportName string) string {
+	suffix := strings.TrimPrefix(screenshotPattern, "*")
+	base := strings.TrimSuffix(filepath.Base(tmplPath), filepath.Ext(tmplPath))
+	if viewportName != "" {
+		base += "." + viewportName
+	}
+
+	return filepath.Join(filepath.Dir(tmplPath), base+suffix)
+}
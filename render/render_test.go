@@ -0,0 +1,143 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScreenshotName(t *testing.T) {
+	cases := []struct {
+		name              string
+		tmplPath          string
+		screenshotPattern string
+		viewportName      string
+		want              string
+	}{
+		{
+			name:              "no viewport",
+			tmplPath:          "profile.gotmpl",
+			screenshotPattern: "*.screenshot.jpeg",
+			want:              "profile.screenshot.jpeg",
+		},
+		{
+			name:              "with viewport",
+			tmplPath:          "profile.gotmpl",
+			screenshotPattern: "*.screenshot.jpeg",
+			viewportName:      "mobile",
+			want:              "profile.mobile.screenshot.jpeg",
+		},
+		{
+			name:              "nested dir is preserved",
+			tmplPath:          "templates/profile.gotmpl",
+			screenshotPattern: "*.screenshot.jpeg",
+			want:              filepath.Join("templates", "profile.screenshot.jpeg"),
+		},
+		{
+			name:              "custom suffix",
+			tmplPath:          "profile.gotmpl",
+			screenshotPattern: "*.shot.jpg",
+			want:              "profile.shot.jpg",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := screenshotName(tc.tmplPath, tc.screenshotPattern, tc.viewportName)
+			if got != tc.want {
+				t.Errorf("screenshotName() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	cases := []struct {
+		name string
+		in   Options
+		want Options
+	}{
+		{
+			name: "all zero fills in every default",
+			in:   Options{Name: "mobile"},
+			want: Options{Name: "mobile", Width: DefaultOptions.Width, Height: DefaultOptions.Height,
+				DeviceScaleFactor: DefaultOptions.DeviceScaleFactor, JPEGQuality: DefaultOptions.JPEGQuality},
+		},
+		{
+			name: "configured fields are left alone",
+			in:   Options{Width: 320, Height: 480, DeviceScaleFactor: 2, JPEGQuality: 75},
+			want: Options{Width: 320, Height: 480, DeviceScaleFactor: 2, JPEGQuality: 75},
+		},
+		{
+			name: "partial overrides only fill the zero fields",
+			in:   Options{Width: 320},
+			want: Options{Width: 320, Height: DefaultOptions.Height,
+				DeviceScaleFactor: DefaultOptions.DeviceScaleFactor, JPEGQuality: DefaultOptions.JPEGQuality},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := withDefaults(tc.in)
+			if got != tc.want {
+				t.Errorf("withDefaults() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadFixture(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("no data pattern returns empty struct", func(t *testing.T) {
+		data, err := loadFixture(filepath.Join(dir, "profile.gotmpl"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != (struct{}{}) {
+			t.Errorf("loadFixture() = %#v, want empty struct", data)
+		}
+	})
+
+	t.Run("no matching fixture file returns empty struct", func(t *testing.T) {
+		data, err := loadFixture(filepath.Join(dir, "profile.gotmpl"), "*.toml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != (struct{}{}) {
+			t.Errorf("loadFixture() = %#v, want empty struct", data)
+		}
+	})
+
+	t.Run("toml fixture is decoded", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "profile.toml"), []byte(`name = "jane"`), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := loadFixture(filepath.Join(dir, "profile.gotmpl"), "*.toml")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, ok := data.(map[string]any)
+		if !ok || m["name"] != "jane" {
+			t.Errorf("loadFixture() = %#v, want map with name=jane", data)
+		}
+	})
+
+	t.Run("json fixture is decoded", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "home.json"), []byte(`{"name": "jane"}`), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := loadFixture(filepath.Join(dir, "home.gotmpl"), "*.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, ok := data.(map[string]any)
+		if !ok || m["name"] != "jane" {
+			t.Errorf("loadFixture() = %#v, want map with name=jane", data)
+		}
+	})
+}